@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	sketchMagic   = "SKCH"
+	sketchVersion = 2
+
+	// sketchFixedHeaderLen covers every header field of known size: magic,
+	// version, depth, width, n, and the length prefix of the variable-size
+	// HashID that follows it.
+	sketchFixedHeaderLen = len(sketchMagic) + 1 + 4 + 4 + 8 + 2
+
+	// maxSketchCells bounds depth*width so a crafted header can't be turned
+	// into a multi-gigabyte allocation (or an overflowed, wrapped-negative
+	// byte count) before its claimed size has even been checked against the
+	// actual input length.
+	maxSketchCells = 1 << 26
+)
+
+// Errors returned by Deserialize when the input is not a valid encoded
+// sketch.
+var (
+	ErrBadMagic      = errors.New("sketch: bad magic header")
+	ErrVersion       = errors.New("sketch: unsupported version")
+	ErrChecksum      = errors.New("sketch: checksum mismatch")
+	ErrTruncated     = errors.New("sketch: truncated data")
+	ErrUnknownHash   = errors.New("sketch: unknown hash id")
+	ErrBadDimensions = errors.New("sketch: depth/width out of range")
+)
+
+// validateDimensions rejects non-positive depth/width and, without risking
+// overflow itself, rejects a depth*width product larger than
+// maxSketchCells.
+func validateDimensions(depth, width int) error {
+	if depth <= 0 || width <= 0 {
+		return fmt.Errorf("%w: depth=%d, width=%d", ErrBadDimensions, depth, width)
+	}
+	if depth > maxSketchCells || width > maxSketchCells || depth > maxSketchCells/width {
+		return fmt.Errorf("%w: depth=%d, width=%d exceeds %d cells", ErrBadDimensions, depth, width, maxSketchCells)
+	}
+	return nil
+}
+
+// hashRegistry maps a HashID to the hash function Deserialize should use to
+// reconstruct it. Only parameterless hash functions can be registered here;
+// keyed ones (e.g. maphash, whose HashID embeds a seed) have no way to
+// recover their state from the HashID string alone, so Deserialize rejects
+// them with ErrUnknownHash instead of silently leaving hashFunc nil.
+var hashRegistry = map[string]func([]byte) uint64{
+	"fnv64": hashFNV,
+}
+
+// lookupHash reconstructs a hash function from its HashID.
+func lookupHash(hashID string) (func([]byte) uint64, error) {
+	fn, ok := hashRegistry[hashID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownHash, hashID)
+	}
+	return fn, nil
+}
+
+// Serialize encodes the sketch into a versioned binary format:
+//
+//	magic      [4]byte "SKCH"
+//	version    uint8
+//	depth      uint32
+//	width      uint32
+//	n          uint64
+//	hashIDLen  uint16
+//	hashID     [hashIDLen]byte
+//	counters   [depth*width]uint64, little-endian, row-major
+//	crc32      uint32, IEEE, over every preceding byte
+func (ts *DataSketch) Serialize() []byte {
+	hashID := []byte(ts.HashID)
+	buf := make([]byte, sketchFixedHeaderLen+len(hashID)+ts.Depth*ts.Width*8+4)
+
+	i := copy(buf, sketchMagic)
+	buf[i] = sketchVersion
+	i++
+	binary.LittleEndian.PutUint32(buf[i:], uint32(ts.Depth))
+	i += 4
+	binary.LittleEndian.PutUint32(buf[i:], uint32(ts.Width))
+	i += 4
+	binary.LittleEndian.PutUint64(buf[i:], ts.N)
+	i += 8
+	binary.LittleEndian.PutUint16(buf[i:], uint16(len(hashID)))
+	i += 2
+	i += copy(buf[i:], hashID)
+
+	for row := range ts.Summary {
+		for _, c := range ts.Summary[row] {
+			binary.LittleEndian.PutUint64(buf[i:], c)
+			i += 8
+		}
+	}
+
+	crc := crc32.ChecksumIEEE(buf[:i])
+	binary.LittleEndian.PutUint32(buf[i:], crc)
+	return buf
+}
+
+// Deserialize decodes a sketch previously produced by Serialize, replacing
+// the receiver's contents, including its HashID and hash function: it is
+// safe to call on a zero-value DataSketch, e.g. var ts DataSketch; then
+// gob-decoding into &ts, which calls UnmarshalBinary. It validates the
+// magic header and version before looking at the body, and the CRC32
+// trailer before accepting any counters.
+//
+// The wire format does not carry the sender's Misra-Gries candidate set, so
+// Deserialize always disables heavy-hitter tracking on the receiver; call
+// EnableHeavyHitters afterward to (re)start tracking from this point
+// forward.
+func (ts *DataSketch) Deserialize(data []byte) error {
+	if len(data) < sketchFixedHeaderLen {
+		return ErrTruncated
+	}
+	if string(data[:len(sketchMagic)]) != sketchMagic {
+		return ErrBadMagic
+	}
+
+	i := len(sketchMagic)
+	version := data[i]
+	i++
+	if version != sketchVersion {
+		return ErrVersion
+	}
+
+	depth := int(binary.LittleEndian.Uint32(data[i:]))
+	i += 4
+	width := int(binary.LittleEndian.Uint32(data[i:]))
+	i += 4
+	n := binary.LittleEndian.Uint64(data[i:])
+	i += 8
+	hashIDLen := int(binary.LittleEndian.Uint16(data[i:]))
+	i += 2
+
+	if err := validateDimensions(depth, width); err != nil {
+		return err
+	}
+	if want := sketchFixedHeaderLen + hashIDLen + depth*width*8 + 4; len(data) != want {
+		return ErrTruncated
+	}
+
+	hashID := string(data[i : i+hashIDLen])
+	i += hashIDLen
+
+	hashFunc, err := lookupHash(hashID)
+	if err != nil {
+		return err
+	}
+
+	crc := crc32.ChecksumIEEE(data[:len(data)-4])
+	if crc != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return ErrChecksum
+	}
+
+	summary := make([][]uint64, depth)
+	for row := range summary {
+		summary[row] = make([]uint64, width)
+		for col := range summary[row] {
+			summary[row][col] = binary.LittleEndian.Uint64(data[i:])
+			i += 8
+		}
+	}
+
+	ts.Depth = depth
+	ts.Width = width
+	ts.Summary = summary
+	ts.N = n
+	ts.HashID = hashID
+	ts.hashFunc = hashFunc
+	ts.heavyHittersEnabled = false
+	ts.candidates = nil
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (ts *DataSketch) MarshalBinary() ([]byte, error) {
+	return ts.Serialize(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (ts *DataSketch) UnmarshalBinary(data []byte) error {
+	return ts.Deserialize(data)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSerializeDeserializeRoundTrip(t *testing.T) {
+	ts := NewWithEstimates(0.01, 0.01)
+	for i := 0; i < 10; i++ {
+		AddT(ts, i, IntKey)
+	}
+
+	data := ts.Serialize()
+
+	var got DataSketch
+	if err := got.Deserialize(data); err != nil {
+		t.Fatalf("Deserialize() error = %v", err)
+	}
+
+	if got.Depth != ts.Depth || got.Width != ts.Width || got.N != ts.N || got.HashID != ts.HashID {
+		t.Fatalf("Deserialize() = %+v, want depth/width/N/HashID matching original", got)
+	}
+	if gotCount, wantCount := CountT(&got, 3, IntKey), CountT(ts, 3, IntKey); gotCount != wantCount {
+		t.Errorf("Count(3) after round-trip = %d, want %d", gotCount, wantCount)
+	}
+}
+
+func TestUnmarshalBinaryIntoZeroValue(t *testing.T) {
+	ts := NewSketchFNV(4, 64)
+	AddT(ts, "x", StringKey)
+	data, err := ts.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+
+	var got DataSketch
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+
+	// Regression: UnmarshalBinary into a zero-value DataSketch left
+	// hashFunc nil, so any later Add/Count panicked.
+	got.Add([]byte("y"))
+	if got.Count([]byte("y")) == 0 {
+		t.Errorf("Count(y) = 0 after Add, want >= 1")
+	}
+}
+
+func TestDeserializeRejectsBadInput(t *testing.T) {
+	ts := NewSketchFNV(2, 8)
+	AddT(ts, "x", StringKey)
+	good := ts.Serialize()
+
+	corruptMagic := append([]byte(nil), good...)
+	corruptMagic[0] = 'X'
+
+	corruptCRC := append([]byte(nil), good...)
+	corruptCRC[len(corruptCRC)-1] ^= 0xFF
+
+	truncated := good[:len(good)-1]
+
+	cases := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"bad magic", corruptMagic, ErrBadMagic},
+		{"bad checksum", corruptCRC, ErrChecksum},
+		{"truncated", truncated, ErrTruncated},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got DataSketch
+			if err := got.Deserialize(c.data); !errors.Is(err, c.want) {
+				t.Errorf("Deserialize() error = %v, want %v", err, c.want)
+			}
+		})
+	}
+}
+
+func TestDeserializeRejectsOversizedDimensions(t *testing.T) {
+	ts := NewSketchFNV(2, 8)
+	data := ts.Serialize()
+
+	// Overwrite depth and width (right after the 4-byte magic + 1-byte
+	// version) with values whose product overflows before it can be
+	// compared against the actual (tiny) input length.
+	data[5] = 0xFF
+	data[6] = 0xFF
+	data[7] = 0xFF
+	data[8] = 0x7F
+	data[9] = 0xFF
+	data[10] = 0xFF
+	data[11] = 0xFF
+	data[12] = 0x7F
+
+	var got DataSketch
+	if err := got.Deserialize(data); !errors.Is(err, ErrBadDimensions) {
+		t.Errorf("Deserialize() error = %v, want ErrBadDimensions", err)
+	}
+}
+
+func TestDeserializeRejectsUnknownHashID(t *testing.T) {
+	ts := NewSketchFNV(2, 8)
+	data := ts.Serialize()
+
+	var got DataSketch
+	if err := got.Deserialize(data); err != nil {
+		t.Fatalf("sanity Deserialize() error = %v", err)
+	}
+
+	// Re-encode with an unregistered HashID so the keyed (e.g. maphash) case
+	// is rejected instead of leaving hashFunc nil.
+	got.HashID = "unknown-hash"
+	tampered := got.Serialize()
+
+	var reDeserialized DataSketch
+	if err := reDeserialized.Deserialize(tampered); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("Deserialize() error = %v, want ErrUnknownHash", err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// HeavyHitter is a single entry returned by HeavyHitters: a tracked item
+// together with its CMS-estimated frequency and the sketch's current error
+// bound on that estimate.
+type HeavyHitter struct {
+	Key   []byte
+	Count uint64
+	Error uint64
+}
+
+// ErrHeavyHittersDisabled is returned by HeavyHitters when the sketch has no
+// trustworthy Misra-Gries candidate set to query: tracking was turned off
+// with DisableHeavyHitters, or was invalidated by an operation with no
+// defined way to carry it forward (Intersection, ANotB, Deserialize,
+// MergeReader). Call EnableHeavyHitters to (re)start tracking from this
+// point on.
+var ErrHeavyHittersDisabled = errors.New("sketch: heavy-hitter tracking is disabled or stale")
+
+// EnableHeavyHitters turns on Misra-Gries candidate tracking for future
+// Add/AddN calls, so HeavyHitters can later be queried. NewSketchFNV and
+// NewSketchMaphash already call this, so tracking is on by default; this is
+// for re-enabling it after DisableHeavyHitters or after an operation that
+// invalidates the candidate set (see ErrHeavyHittersDisabled).
+func (ts *DataSketch) EnableHeavyHitters() {
+	ts.heavyHittersEnabled = true
+	ts.candidates = make(map[string]uint64, ts.Width)
+}
+
+// DisableHeavyHitters turns off Misra-Gries candidate tracking and frees the
+// candidate set. Tracking is on by default (see EnableHeavyHitters); this is
+// for sketches that will never be queried with HeavyHitters (e.g. the one
+// backing TopK) and shouldn't pay its per-Add/AddN bookkeeping cost.
+func (ts *DataSketch) DisableHeavyHitters() {
+	ts.heavyHittersEnabled = false
+	ts.candidates = nil
+}
+
+// trackHeavyHitter folds n occurrences of x into the sketch's Misra-Gries
+// candidate set in O(Width), regardless of n.
+//
+// The candidate set is capped at Width entries, mirroring the precision the
+// sketch was already sized for: HeavyHitters(phi) only carries its usual
+// guarantee for phi >= 1/Width. When the set is full and x is not already a
+// candidate, every candidate's counter is decremented by min(n, m), where m
+// is the current minimum value, in a single batched pass (rather than once
+// per unit of n): m is exactly how many of the n arrivals it takes for some
+// entry to hit zero and free a slot, and any of the n arrivals left after
+// that become x's counter. The work is one O(Width) pass no matter how
+// large n is.
+func (ts *DataSketch) trackHeavyHitter(x []byte, n uint64) {
+	if !ts.heavyHittersEnabled || n == 0 {
+		return
+	}
+	if ts.candidates == nil {
+		ts.candidates = make(map[string]uint64, ts.Width)
+	}
+	key := string(x)
+
+	if c, ok := ts.candidates[key]; ok {
+		ts.candidates[key] = c + n
+		return
+	}
+	if len(ts.candidates) < ts.Width {
+		ts.candidates[key] = n
+		return
+	}
+
+	m := ts.minCandidate()
+	if n < m {
+		for k, c := range ts.candidates {
+			ts.candidates[k] = c - n
+		}
+		return
+	}
+	for k, c := range ts.candidates {
+		if c == m {
+			delete(ts.candidates, k)
+		} else {
+			ts.candidates[k] = c - m
+		}
+	}
+	if n -= m; n > 0 {
+		ts.candidates[key] = n
+	}
+}
+
+// minCandidate returns the smallest counter currently in the candidate set.
+// It is only called when the set is full, so it always has an entry to
+// return.
+func (ts *DataSketch) minCandidate() uint64 {
+	var m uint64
+	first := true
+	for _, c := range ts.candidates {
+		if first || c < m {
+			m = c
+			first = false
+		}
+	}
+	return m
+}
+
+// mergeCandidates combines two Misra-Gries candidate sets into one bounded
+// by capacity: counts for shared keys are summed, then, while the result
+// has more than capacity entries, the (capacity+1)-th largest count is
+// subtracted from every entry and entries that reach zero are dropped. This
+// is the standard merge-and-prune step for Misra-Gries summaries and keeps
+// the same approximation guarantee as a single capacity-bounded set fed the
+// interleaved stream would have had.
+func mergeCandidates(capacity int, a, b map[string]uint64) map[string]uint64 {
+	merged := make(map[string]uint64, len(a)+len(b))
+	for k, v := range a {
+		merged[k] += v
+	}
+	for k, v := range b {
+		merged[k] += v
+	}
+	if capacity <= 0 {
+		return map[string]uint64{}
+	}
+
+	for len(merged) > capacity {
+		counts := make([]uint64, 0, len(merged))
+		for _, v := range merged {
+			counts = append(counts, v)
+		}
+		sort.Slice(counts, func(i, j int) bool { return counts[i] > counts[j] })
+		threshold := counts[capacity]
+
+		for k, v := range merged {
+			if v <= threshold {
+				delete(merged, k)
+			} else {
+				merged[k] = v - threshold
+			}
+		}
+	}
+	return merged
+}
+
+// HeavyHitters returns every tracked item whose estimated count exceeds
+// phi*N, where N is the total number of inserts (DataSketch.N). It verifies
+// each Misra-Gries candidate's frequency with Count before reporting it,
+// together with the CMS's standard 2N/Width error bound on that estimate.
+// It returns ErrHeavyHittersDisabled if the sketch has no trustworthy
+// candidate set to query; see EnableHeavyHitters.
+//
+// The candidate set is capped at Width entries rather than the textbook
+// ⌈1/phi⌉ (phi isn't known until query time, long after Add has been
+// populating it), so the usual Misra-Gries guarantee only holds for
+// phi >= 1/Width: a smaller phi can make HeavyHitters miss true heavy
+// hitters rather than simply returning none, so callers sizing their
+// sketch with NewWithEstimates should pick epsilon no larger than the
+// smallest phi they intend to query.
+func (ts *DataSketch) HeavyHitters(phi float64) ([]HeavyHitter, error) {
+	if !ts.heavyHittersEnabled {
+		return nil, ErrHeavyHittersDisabled
+	}
+
+	threshold := phi * float64(ts.N)
+	errBound := uint64(math.Ceil(2 * float64(ts.N) / float64(ts.Width)))
+
+	var hits []HeavyHitter
+	for key := range ts.candidates {
+		count := ts.Count([]byte(key))
+		if float64(count) > threshold {
+			hits = append(hits, HeavyHitter{
+				Key:   []byte(key),
+				Count: count,
+				Error: errBound,
+			})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Count > hits[j].Count })
+	return hits, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHeavyHittersEnabledByDefault(t *testing.T) {
+	ts := NewSketchFNV(4, 256)
+	for i := 0; i < 1000; i++ {
+		AddT(ts, "popular", StringKey)
+	}
+
+	hits, err := ts.HeavyHitters(0.1)
+	if err != nil {
+		t.Fatalf("HeavyHitters() error = %v, want tracking enabled out of the box", err)
+	}
+	if len(hits) != 1 || string(hits[0].Key) != "popular" {
+		t.Errorf("HeavyHitters() = %+v, want [popular]", hits)
+	}
+}
+
+func TestDisableHeavyHitters(t *testing.T) {
+	ts := NewSketchFNV(4, 256)
+	AddT(ts, "popular", StringKey)
+	ts.DisableHeavyHitters()
+	AddT(ts, "popular", StringKey)
+
+	if _, err := ts.HeavyHitters(0.1); !errors.Is(err, ErrHeavyHittersDisabled) {
+		t.Errorf("HeavyHitters() error = %v, want ErrHeavyHittersDisabled", err)
+	}
+}
+
+func TestHeavyHittersFindsFrequentItem(t *testing.T) {
+	ts := NewSketchFNV(4, 256)
+	ts.EnableHeavyHitters()
+
+	for i := 0; i < 1000; i++ {
+		AddT(ts, "popular", StringKey)
+	}
+	for i := 0; i < 5; i++ {
+		AddT(ts, "rare", StringKey)
+	}
+
+	hits, err := ts.HeavyHitters(0.1)
+	if err != nil {
+		t.Fatalf("HeavyHitters() error = %v", err)
+	}
+
+	found := false
+	for _, h := range hits {
+		if string(h.Key) == "popular" {
+			found = true
+		}
+		if string(h.Key) == "rare" {
+			t.Errorf("HeavyHitters() unexpectedly reported rare item: %+v", h)
+		}
+	}
+	if !found {
+		t.Errorf("HeavyHitters() = %+v, want it to include \"popular\"", hits)
+	}
+}
+
+// TestUnionPreservesHeavyHitters is a regression test: merging a sketch that
+// has tracked a heavy hitter with an empty, equally-enabled sketch used to
+// silently drop the candidate set, so HeavyHitters on the union reported
+// nothing even though Count still estimated the item correctly.
+func TestUnionPreservesHeavyHitters(t *testing.T) {
+	ts := NewSketchFNV(4, 256)
+	ts.EnableHeavyHitters()
+	for i := 0; i < 1000; i++ {
+		AddT(ts, "popular", StringKey)
+	}
+
+	empty := NewSketchFNV(4, 256)
+	empty.EnableHeavyHitters()
+
+	merged, err := ts.Union(empty)
+	if err != nil {
+		t.Fatalf("Union() error = %v", err)
+	}
+	if merged.N != 1000 {
+		t.Fatalf("merged.N = %d, want 1000", merged.N)
+	}
+	if got := CountT(merged, "popular", StringKey); got != 1000 {
+		t.Fatalf("merged Count(popular) = %d, want 1000", got)
+	}
+
+	hits, err := merged.HeavyHitters(0.1)
+	if err != nil {
+		t.Fatalf("merged.HeavyHitters() error = %v", err)
+	}
+	if len(hits) != 1 || string(hits[0].Key) != "popular" {
+		t.Errorf("merged.HeavyHitters() = %+v, want [popular]", hits)
+	}
+}
+
+func TestIntersectionDisablesHeavyHitters(t *testing.T) {
+	a := NewSketchFNV(4, 256)
+	a.EnableHeavyHitters()
+	AddT(a, "x", StringKey)
+
+	b := NewSketchFNV(4, 256)
+	b.EnableHeavyHitters()
+	AddT(b, "x", StringKey)
+
+	inter, err := a.Intersection(b)
+	if err != nil {
+		t.Fatalf("Intersection() error = %v", err)
+	}
+	if _, err := inter.HeavyHitters(0.1); !errors.Is(err, ErrHeavyHittersDisabled) {
+		t.Errorf("HeavyHitters() on Intersection result error = %v, want ErrHeavyHittersDisabled", err)
+	}
+}
+
+func TestAddNBulkDoesNotBypassCandidateCap(t *testing.T) {
+	ts := NewSketchFNV(2, 4) // capacity 4: forces eviction with few distinct keys
+	ts.EnableHeavyHitters()
+
+	for i := 0; i < 4; i++ {
+		AddT(ts, i, IntKey)
+	}
+	ts.AddN(IntKey(999), 1<<20) // large bulk add of a brand-new key
+
+	if len(ts.candidates) > ts.Width {
+		t.Errorf("len(candidates) = %d, want <= Width (%d)", len(ts.candidates), ts.Width)
+	}
+}
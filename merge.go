@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ErrIncompatible is returned by Union, Intersection, ANotB, and MergeReader
+// when the two sketches cannot be combined.
+var ErrIncompatible = errors.New("sketch: incompatible sketches")
+
+// Compatible reports whether other can be combined with ts by Union,
+// Intersection, or ANotB: both must have the same depth, width, and hash
+// function.
+func (ts *DataSketch) Compatible(other *DataSketch) error {
+	if ts.Depth != other.Depth || ts.Width != other.Width {
+		return fmt.Errorf("%w: depth/width mismatch (%dx%d vs %dx%d)", ErrIncompatible, ts.Depth, ts.Width, other.Depth, other.Width)
+	}
+	if ts.HashID != other.HashID {
+		return fmt.Errorf("%w: hash mismatch (%q vs %q)", ErrIncompatible, ts.HashID, other.HashID)
+	}
+	return nil
+}
+
+// Union returns a new sketch whose counters are the elementwise sum of the
+// two sketches' matrices. If both ts and other have heavy-hitter tracking
+// enabled, the result does too, with their Misra-Gries candidate sets
+// merged (see mergeCandidates); otherwise the result has tracking disabled
+// rather than silently carrying forward a partial or absent candidate set.
+func (ts *DataSketch) Union(other *DataSketch) (*DataSketch, error) {
+	if err := ts.Compatible(other); err != nil {
+		return nil, err
+	}
+	newTs := newSketch(ts.Depth, ts.Width, ts.HashID, ts.hashFunc)
+	for row := range ts.Summary {
+		for col := range ts.Summary[row] {
+			newTs.Summary[row][col] = ts.Summary[row][col] + other.Summary[row][col]
+		}
+	}
+	newTs.N = ts.N + other.N
+	if ts.heavyHittersEnabled && other.heavyHittersEnabled {
+		newTs.heavyHittersEnabled = true
+		newTs.candidates = mergeCandidates(newTs.Width, ts.candidates, other.candidates)
+	}
+	return newTs, nil
+}
+
+// Intersection returns a new sketch whose counters are the elementwise
+// minimum of the two sketches' matrices. Intersecting two Misra-Gries
+// candidate sets has no defined semantics (an item heavy in both inputs
+// need not be heavy in the intersection, and vice versa), so the result
+// always has heavy-hitter tracking disabled; call EnableHeavyHitters on it
+// to start tracking from this point forward.
+func (ts *DataSketch) Intersection(other *DataSketch) (*DataSketch, error) {
+	if err := ts.Compatible(other); err != nil {
+		return nil, err
+	}
+	newTs := newSketch(ts.Depth, ts.Width, ts.HashID, ts.hashFunc)
+	for row := range ts.Summary {
+		for col := range ts.Summary[row] {
+			newTs.Summary[row][col] = min64(ts.Summary[row][col], other.Summary[row][col])
+		}
+	}
+	return newTs, nil
+}
+
+// ANotB returns a new sketch whose counters are the elementwise, saturating
+// difference ts - other. As with Intersection, set difference has no
+// defined candidate-merge semantics, so the result always has heavy-hitter
+// tracking disabled; call EnableHeavyHitters on it to start tracking from
+// this point forward.
+func (ts *DataSketch) ANotB(other *DataSketch) (*DataSketch, error) {
+	if err := ts.Compatible(other); err != nil {
+		return nil, err
+	}
+	newTs := newSketch(ts.Depth, ts.Width, ts.HashID, ts.hashFunc)
+	for row := range ts.Summary {
+		for col := range ts.Summary[row] {
+			a, b := ts.Summary[row][col], other.Summary[row][col]
+			if a > b {
+				newTs.Summary[row][col] = a - b
+			}
+		}
+	}
+	return newTs, nil
+}
+
+// MergeReader reads a sketch previously written by Serialize from r and
+// folds its counters into the receiver via elementwise sum. It reads r
+// counter by counter rather than buffering the serialized bytes, but it
+// does hold the decoded incoming matrix (depth*width counters) in memory
+// until the CRC32 trailer has been verified. This is meant for map-reduce style
+// aggregation of many partial sketches stored on disk or received over the
+// network.
+//
+// MergeReader only streams in counters, not the sender's Misra-Gries
+// candidate set, so it always disables the receiver's heavy-hitter
+// tracking (if any) rather than let it silently go stale relative to the
+// merged counts; call EnableHeavyHitters on the receiver afterward to
+// resume tracking from this point forward.
+func (ts *DataSketch) MergeReader(r io.Reader) error {
+	fixedHeader := make([]byte, sketchFixedHeaderLen)
+	if _, err := io.ReadFull(r, fixedHeader); err != nil {
+		return ErrTruncated
+	}
+	if string(fixedHeader[:len(sketchMagic)]) != sketchMagic {
+		return ErrBadMagic
+	}
+
+	i := len(sketchMagic)
+	version := fixedHeader[i]
+	i++
+	if version != sketchVersion {
+		return ErrVersion
+	}
+	depth := int(binary.LittleEndian.Uint32(fixedHeader[i:]))
+	i += 4
+	width := int(binary.LittleEndian.Uint32(fixedHeader[i:]))
+	i += 4
+	n := binary.LittleEndian.Uint64(fixedHeader[i:])
+	i += 8
+	hashIDLen := int(binary.LittleEndian.Uint16(fixedHeader[i:]))
+
+	if depth != ts.Depth || width != ts.Width {
+		return fmt.Errorf("%w: depth/width mismatch (%dx%d vs %dx%d)", ErrIncompatible, ts.Depth, ts.Width, depth, width)
+	}
+
+	hashID := make([]byte, hashIDLen)
+	if _, err := io.ReadFull(r, hashID); err != nil {
+		return ErrTruncated
+	}
+	if string(hashID) != ts.HashID {
+		return fmt.Errorf("%w: hash mismatch (%q vs %q)", ErrIncompatible, ts.HashID, hashID)
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(fixedHeader)
+	crc.Write(hashID)
+
+	incoming := make([][]uint64, depth)
+	counter := make([]byte, 8)
+	for row := 0; row < depth; row++ {
+		incoming[row] = make([]uint64, width)
+		for col := 0; col < width; col++ {
+			if _, err := io.ReadFull(r, counter); err != nil {
+				return ErrTruncated
+			}
+			crc.Write(counter)
+			incoming[row][col] = binary.LittleEndian.Uint64(counter)
+		}
+	}
+
+	trailer := make([]byte, 4)
+	if _, err := io.ReadFull(r, trailer); err != nil {
+		return ErrTruncated
+	}
+	if crc.Sum32() != binary.LittleEndian.Uint32(trailer) {
+		return ErrChecksum
+	}
+
+	// Only mutate the receiver once the whole stream has been read and
+	// verified; a checksum or truncation failure above must leave ts
+	// untouched rather than partially merged.
+	for row := range incoming {
+		for col := range incoming[row] {
+			ts.Summary[row][col] += incoming[row][col]
+		}
+	}
+	ts.N += n
+	ts.heavyHittersEnabled = false
+	ts.candidates = nil
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"hash/maphash"
+	"testing"
+)
+
+func TestUnionIntersectionANotB(t *testing.T) {
+	// Width is large relative to the handful of distinct keys here so that
+	// ANotB's per-cell subtraction isn't muddied by unrelated hash
+	// collisions between a's and b's items (a known source of undercounting
+	// in count-min-sketch set operations, not specific to this test).
+	a := NewSketchFNV(4, 4096)
+	AddT(a, "shared", StringKey)
+	AddT(a, "shared", StringKey)
+	AddT(a, "onlyA", StringKey)
+
+	b := NewSketchFNV(4, 4096)
+	AddT(b, "shared", StringKey)
+	AddT(b, "onlyB", StringKey)
+
+	union, err := a.Union(b)
+	if err != nil {
+		t.Fatalf("Union() error = %v", err)
+	}
+	if got := CountT(union, "shared", StringKey); got < 3 {
+		t.Errorf("union Count(shared) = %d, want >= 3", got)
+	}
+	if union.N != a.N+b.N {
+		t.Errorf("union.N = %d, want %d", union.N, a.N+b.N)
+	}
+
+	inter, err := a.Intersection(b)
+	if err != nil {
+		t.Fatalf("Intersection() error = %v", err)
+	}
+	if got := CountT(inter, "shared", StringKey); got < 1 {
+		t.Errorf("intersection Count(shared) = %d, want >= 1", got)
+	}
+	if got := CountT(inter, "onlyA", StringKey); got != 0 {
+		t.Errorf("intersection Count(onlyA) = %d, want 0", got)
+	}
+
+	diff, err := a.ANotB(b)
+	if err != nil {
+		t.Fatalf("ANotB() error = %v", err)
+	}
+	if got := CountT(diff, "onlyA", StringKey); got < 1 {
+		t.Errorf("ANotB Count(onlyA) = %d, want >= 1", got)
+	}
+}
+
+func TestCompatibleRejectsSizeMismatch(t *testing.T) {
+	a := NewSketchFNV(4, 256)
+	b := NewSketchFNV(4, 128)
+
+	if _, err := a.Union(b); !errors.Is(err, ErrIncompatible) {
+		t.Errorf("Union() error = %v, want ErrIncompatible", err)
+	}
+}
+
+func TestCompatibleRejectsMismatchedMaphashSeeds(t *testing.T) {
+	seed1 := maphash.MakeSeed()
+	seed2 := maphash.MakeSeed()
+	for seed2 == seed1 {
+		seed2 = maphash.MakeSeed()
+	}
+
+	a := NewSketchMaphash(4, 256, seed1)
+	b := NewSketchMaphash(4, 256, seed2)
+
+	if err := a.Compatible(b); !errors.Is(err, ErrIncompatible) {
+		t.Errorf("Compatible() error = %v, want ErrIncompatible for mismatched seeds", err)
+	}
+
+	c := NewSketchMaphash(4, 256, seed1)
+	if err := a.Compatible(c); err != nil {
+		t.Errorf("Compatible() error = %v, want nil for matching seeds", err)
+	}
+}
+
+func TestMergeReaderRoundTrip(t *testing.T) {
+	a := NewSketchFNV(4, 256)
+	AddT(a, "shared", StringKey)
+	AddT(a, "onlyA", StringKey)
+
+	b := NewSketchFNV(4, 256)
+	AddT(b, "shared", StringKey)
+	AddT(b, "onlyB", StringKey)
+
+	data := b.Serialize()
+	if err := a.MergeReader(bytes.NewReader(data)); err != nil {
+		t.Fatalf("MergeReader() error = %v", err)
+	}
+
+	if a.N != 4 {
+		t.Errorf("a.N = %d, want 4", a.N)
+	}
+	if got := CountT(a, "shared", StringKey); got < 2 {
+		t.Errorf("Count(shared) = %d, want >= 2", got)
+	}
+	if got := CountT(a, "onlyB", StringKey); got < 1 {
+		t.Errorf("Count(onlyB) = %d, want >= 1", got)
+	}
+}
+
+func TestMergeReaderRejectsDimensionMismatch(t *testing.T) {
+	a := NewSketchFNV(4, 256)
+	b := NewSketchFNV(4, 128)
+	data := b.Serialize()
+
+	if err := a.MergeReader(bytes.NewReader(data)); !errors.Is(err, ErrIncompatible) {
+		t.Errorf("MergeReader() error = %v, want ErrIncompatible", err)
+	}
+}
+
+// TestMergeReaderLeavesReceiverUntouchedOnChecksumFailure is a regression
+// test: MergeReader used to add each counter into ts.Summary as it read the
+// stream, so a corrupted payload left the receiver partially merged even
+// though it reported ErrChecksum.
+func TestMergeReaderLeavesReceiverUntouchedOnChecksumFailure(t *testing.T) {
+	a := NewSketchFNV(4, 256)
+	AddT(a, "onlyA", StringKey)
+	before := a.Serialize()
+
+	b := NewSketchFNV(4, 256)
+	AddT(b, "shared", StringKey)
+	AddT(b, "onlyB", StringKey)
+	data := b.Serialize()
+	data[len(data)-1] ^= 0xFF // corrupt the CRC trailer
+
+	if err := a.MergeReader(bytes.NewReader(data)); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("MergeReader() error = %v, want ErrChecksum", err)
+	}
+
+	after := a.Serialize()
+	if !bytes.Equal(before, after) {
+		t.Errorf("MergeReader() mutated receiver despite checksum failure")
+	}
+}
+
+func TestMergeReaderRejectsTruncatedStream(t *testing.T) {
+	a := NewSketchFNV(4, 256)
+	AddT(a, "onlyA", StringKey)
+	before := a.Serialize()
+
+	b := NewSketchFNV(4, 256)
+	AddT(b, "shared", StringKey)
+	data := b.Serialize()
+	truncated := data[:len(data)-10]
+
+	if err := a.MergeReader(bytes.NewReader(truncated)); !errors.Is(err, ErrTruncated) {
+		t.Errorf("MergeReader() error = %v, want ErrTruncated", err)
+	}
+
+	after := a.Serialize()
+	if !bytes.Equal(before, after) {
+		t.Errorf("MergeReader() mutated receiver despite truncated stream")
+	}
+}
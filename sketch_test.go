@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestAddCount(t *testing.T) {
+	ts := NewWithEstimates(0.001, 0.001)
+
+	for i := 0; i < 500; i++ {
+		AddT(ts, "popular", StringKey)
+	}
+	AddT(ts, "rare", StringKey)
+
+	if got := CountT(ts, "popular", StringKey); got < 500 {
+		t.Errorf("Count(popular) = %d, want >= 500 (CMS never underestimates)", got)
+	}
+	if got := CountT(ts, "rare", StringKey); got < 1 {
+		t.Errorf("Count(rare) = %d, want >= 1", got)
+	}
+	if got := CountT(ts, "unseen", StringKey); got > 10 {
+		t.Errorf("Count(unseen) = %d, want a small overestimate at most", got)
+	}
+}
+
+func TestAddN(t *testing.T) {
+	ts := NewWithEstimates(0.001, 0.001)
+	ts.AddN([]byte("x"), 42)
+
+	if got := ts.Count([]byte("x")); got < 42 {
+		t.Errorf("Count(x) = %d, want >= 42", got)
+	}
+	if ts.N != 42 {
+		t.Errorf("N = %d, want 42", ts.N)
+	}
+}
+
+func TestNewWithEstimatesSizing(t *testing.T) {
+	ts := NewWithEstimates(0.01, 0.01)
+	if ts.Width < 100 {
+		t.Errorf("Width = %d, want >= 100 for epsilon=0.01", ts.Width)
+	}
+	if ts.Depth < 1 {
+		t.Errorf("Depth = %d, want >= 1", ts.Depth)
+	}
+}
+
+// TestNewWithEstimatesRejectsAbsurdEpsilon is a regression test: clamping a
+// negative or near-zero epsilon up to minEpsilonDelta still asked for a
+// multi-billion-counter width, so construction OOM'd instead of panicking.
+// Width must stay bounded by maxSketchCells regardless of how small (or
+// negative) epsilon is.
+func TestNewWithEstimatesRejectsAbsurdEpsilon(t *testing.T) {
+	ts := NewWithEstimates(-1, 0.01)
+	if ts.Width > maxSketchCells {
+		t.Errorf("Width = %d, want <= maxSketchCells (%d)", ts.Width, maxSketchCells)
+	}
+	if ts.Depth*ts.Width > maxSketchCells {
+		t.Errorf("Depth*Width = %d, want <= maxSketchCells (%d)", ts.Depth*ts.Width, maxSketchCells)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// SerializeFunc appends the byte representation of x to buf and returns the
+// resulting slice, following the append-style convention used elsewhere in
+// the standard library (e.g. strconv.AppendInt) so repeated calls can reuse
+// a buffer instead of allocating.
+type SerializeFunc[T any] func(buf []byte, x T) []byte
+
+// Item is a single entry returned by TopK.Top, pairing a tracked value with
+// its CMS-estimated count.
+type Item[T any] struct {
+	Value T
+	Count uint64
+}
+
+// heapEntry is the internal min-heap element: the public Item plus its
+// serialized key, cached so the heap never needs to re-serialize a value to
+// maintain the index map.
+type heapEntry[T any] struct {
+	item Item[T]
+	key  string
+}
+
+// TopK tracks the K most frequent items in a stream in O(log K) per update
+// and constant memory. It estimates counts with an internal DataSketch and
+// keeps a min-heap of the K highest estimated counts seen so far, so the
+// true top-K items are found as long as they clear every item evicted from
+// the heap.
+type TopK[T any] struct {
+	mu        sync.Mutex
+	k         int
+	sketch    *DataSketch
+	serialize SerializeFunc[T]
+	heap      []heapEntry[T]
+	index     map[string]int // serialized key -> index into heap
+}
+
+// PickParams sizes a Count-Min Sketch for a target error rate, returning the
+// depth and width to pass to NewSketch.
+func PickParams(epsilon, delta float64) (d, w int) {
+	sketch := NewWithEstimates(epsilon, delta)
+	return sketch.Depth, sketch.Width
+}
+
+// NewTopK creates a TopK tracking the k most frequent items, estimating
+// counts with a sketch sized for the given error rate. serialize converts a
+// tracked item into the bytes the underlying sketch hashes. A negative k is
+// clamped to 0, giving a TopK that tracks nothing rather than panicking.
+func NewTopK[T any](k int, epsilon, delta float64, serialize SerializeFunc[T]) *TopK[T] {
+	if k < 0 {
+		k = 0
+	}
+	d, w := PickParams(epsilon, delta)
+	sketch := NewSketch(d, w)
+	// TopK already maintains its own top-k heap; it never queries
+	// HeavyHitters, so the sketch's Misra-Gries bookkeeping would just tax
+	// every Add for nothing.
+	sketch.DisableHeavyHitters()
+	return &TopK[T]{
+		k:         k,
+		sketch:    sketch,
+		serialize: serialize,
+		heap:      make([]heapEntry[T], 0, k),
+		index:     make(map[string]int, k),
+	}
+}
+
+// Add records one occurrence of item, updating the underlying sketch and,
+// if item's estimated count now warrants it, the tracked top-K set.
+func (tk *TopK[T]) Add(item T) {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	key := string(tk.serialize(nil, item))
+	tk.sketch.Add([]byte(key))
+	count := tk.sketch.Count([]byte(key))
+
+	if i, ok := tk.index[key]; ok {
+		tk.heap[i].item.Count = count
+		tk.siftDown(tk.siftUp(i))
+		return
+	}
+
+	if len(tk.heap) < tk.k {
+		tk.heap = append(tk.heap, heapEntry[T]{item: Item[T]{Value: item, Count: count}, key: key})
+		i := len(tk.heap) - 1
+		tk.index[key] = i
+		tk.siftUp(i)
+		return
+	}
+
+	if tk.k > 0 && count > tk.heap[0].item.Count {
+		delete(tk.index, tk.heap[0].key)
+		tk.heap[0] = heapEntry[T]{item: Item[T]{Value: item, Count: count}, key: key}
+		tk.index[key] = 0
+		tk.siftDown(0)
+	}
+}
+
+// Top returns the tracked items sorted by descending estimated count.
+func (tk *TopK[T]) Top() []Item[T] {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	items := make([]Item[T], len(tk.heap))
+	for i, e := range tk.heap {
+		items[i] = e.item
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Count > items[j].Count })
+	return items
+}
+
+// Reset clears the tracked top-K set and the underlying sketch.
+func (tk *TopK[T]) Reset() {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	tk.sketch = NewSketch(tk.sketch.Depth, tk.sketch.Width)
+	tk.sketch.DisableHeavyHitters()
+	tk.heap = tk.heap[:0]
+	tk.index = make(map[string]int, tk.k)
+}
+
+// less reports whether heap[i] has a smaller estimated count than heap[j].
+func (tk *TopK[T]) less(i, j int) bool {
+	return tk.heap[i].item.Count < tk.heap[j].item.Count
+}
+
+// swap exchanges heap[i] and heap[j], keeping the index map in sync.
+func (tk *TopK[T]) swap(i, j int) {
+	tk.heap[i], tk.heap[j] = tk.heap[j], tk.heap[i]
+	tk.index[tk.heap[i].key] = i
+	tk.index[tk.heap[j].key] = j
+}
+
+// siftUp moves heap[i] up while it is smaller than its parent, returning its
+// final index.
+func (tk *TopK[T]) siftUp(i int) int {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !tk.less(i, parent) {
+			break
+		}
+		tk.swap(i, parent)
+		i = parent
+	}
+	return i
+}
+
+// siftDown moves heap[i] down while it is larger than a child, restoring the
+// min-heap property.
+func (tk *TopK[T]) siftDown(i int) {
+	n := len(tk.heap)
+	for {
+		left, right := 2*i+1, 2*i+2
+		smallest := i
+		if left < n && tk.less(left, smallest) {
+			smallest = left
+		}
+		if right < n && tk.less(right, smallest) {
+			smallest = right
+		}
+		if smallest == i {
+			return
+		}
+		tk.swap(i, smallest)
+		i = smallest
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestTopK(t *testing.T) {
+	tk := NewTopK(3, 0.01, 0.01, func(buf []byte, x string) []byte {
+		return append(buf, x...)
+	})
+
+	counts := map[string]int{"a": 100, "b": 80, "c": 60, "d": 5, "e": 1}
+	for item, n := range counts {
+		for i := 0; i < n; i++ {
+			tk.Add(item)
+		}
+	}
+
+	top := tk.Top()
+	if len(top) != 3 {
+		t.Fatalf("len(Top()) = %d, want 3", len(top))
+	}
+
+	want := []string{"a", "b", "c"}
+	for i, item := range want {
+		if top[i].Value != item {
+			t.Errorf("Top()[%d].Value = %q, want %q", i, top[i].Value, item)
+		}
+	}
+	for i := 1; i < len(top); i++ {
+		if top[i].Count > top[i-1].Count {
+			t.Errorf("Top() not sorted by descending count: %+v", top)
+		}
+	}
+}
+
+func TestTopKReset(t *testing.T) {
+	tk := NewTopK(2, 0.01, 0.01, func(buf []byte, x string) []byte {
+		return append(buf, x...)
+	})
+	tk.Add("a")
+	tk.Add("b")
+	tk.Reset()
+
+	if top := tk.Top(); len(top) != 0 {
+		t.Errorf("Top() after Reset = %+v, want empty", top)
+	}
+}
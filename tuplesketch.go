@@ -2,195 +2,272 @@
 package main
 
 import (
+	"encoding/binary"
 	"fmt"
-	"math/rand"
+	"hash/fnv"
+	"hash/maphash"
+	"math"
 )
 
-// This Sketch is a struct that represents a sketch.
-// It has two fields:
-//   - HashFunc: A function that takes an integer and returns a hash value.
-//   - Summary: A slice of integers that stores the cardinality of each bucket.
-type DataSketch struct {
-	HashFunc func(x int) int
-	Summary  []int
-}
-
-// NewSketch creates a new sketch.
-// The hash function is a function that takes an integer and returns a hash value.
-// The length of the summary slice is 2^16.
-func NewSketch(hashFunc func(x int) int) *DataSketch {
-	// Create a new sketch.
-	ts := &DataSketch{
-		HashFunc: hashFunc,
-		Summary:  make([]int, 1<<16),
-	}
+// KeySerializer converts a typed key into the byte slice DataSketch hashes.
+// Built-in serializers cover the common cases (IntKey, StringKey, BytesKey);
+// callers can supply their own for arbitrary key types.
+type KeySerializer[T any] func(x T) []byte
 
-	// Return the sketch.
-	return ts
+// IntKey serializes an int as 8 little-endian bytes.
+func IntKey(x int) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(x))
+	return buf
 }
 
-// Add adds an element to the sketch.
-// The element is hashed using the hash function and the corresponding bucket in the summary slice is incremented.
-func (ts *DataSketch) Add(x int) {
-	// Hash the element.
-	hashValue := ts.HashFunc(x)
+// StringKey serializes a string as its raw bytes.
+func StringKey(x string) []byte {
+	return []byte(x)
+}
 
-	// Increment the corresponding bucket in the summary slice.
-	ts.Summary[hashValue]++
+// BytesKey is the identity serializer for keys that are already []byte.
+func BytesKey(x []byte) []byte {
+	return x
 }
 
-// EstimateCardinality estimates the cardinality of the sketch.
-// The cardinality is the sum of the values in the summary slice.
-func (ts *DataSketch) EstimateCardinality() int {
-	// Initialize a variable to store the cardinality.
-	count := 0
+// AddT increments the estimated count of a typed key, e.g. AddT(ts, 42, IntKey).
+func AddT[T any](ts *DataSketch, x T, serialize KeySerializer[T]) {
+	ts.Add(serialize(x))
+}
 
-	// Iterate over the summary slice and add the values to the cardinality variable.
-	for _, x := range ts.Summary {
-		count += x
-	}
+// AddNT increments the estimated count of a typed key by n.
+func AddNT[T any](ts *DataSketch, x T, n uint64, serialize KeySerializer[T]) {
+	ts.AddN(serialize(x), n)
+}
 
-	// Return the cardinality.
-	return count
+// CountT returns the estimated count of a typed key.
+func CountT[T any](ts *DataSketch, x T, serialize KeySerializer[T]) uint64 {
+	return ts.Count(serialize(x))
 }
 
-// Serialize serializes the sketch to a byte slice.
-// The byte slice has the following format:
-//   - The first byte is the length of the summary slice.
-//   - The next `len(summary)` bytes are the values in the summary slice.
-func (ts *DataSketch) Serialize() []byte {
-	// Initialize a byte slice to store the serialized sketch.
-	buf := make([]byte, 1+len(ts.Summary))
+// DataSketch is a Count-Min Sketch: a Depth x Width matrix of counters used
+// to estimate the frequency of items in a stream with bounded error.
+//
+// Each row uses a distinct bucket derived from a single 64-bit hash of the
+// item (FNV-1a or maphash, as named by HashID) via double hashing: bucket(row) = (h1 + row*h2) mod Width,
+// where h1/h2 are the upper/lower 32 bits of the hash. This avoids running
+// Depth independent hash functions while keeping the rows' collisions
+// uncorrelated enough for the CMS error bound to hold.
+type DataSketch struct {
+	Depth   int
+	Width   int
+	Summary [][]uint64
+
+	// N is the total number of items inserted (sum of every AddN increment),
+	// used to derive error bounds and heavy-hitter thresholds.
+	N uint64
+
+	// HashID identifies the hash function used to place items, e.g. "fnv64"
+	// or "maphash". Two sketches must share a HashID (and the same
+	// underlying hash parameters) to be combined by Union, Intersection,
+	// ANotB, or MergeReader; see Compatible.
+	HashID string
+
+	hashFunc func([]byte) uint64
+
+	// heavyHittersEnabled reports whether candidates is being maintained and
+	// is trustworthy; see EnableHeavyHitters.
+	heavyHittersEnabled bool
+
+	// candidates is the Misra-Gries candidate set backing HeavyHitters,
+	// capped at Width entries and maintained on every AddN call once
+	// heavy-hitter tracking is enabled.
+	candidates map[string]uint64
+}
 
-	// Write the length of the summary slice to the byte slice.
-	buf[0] = byte(len(ts.Summary))
+// NewSketch creates a sketch with the given depth (number of hash rows) and
+// width (number of counters per row), hashing items with FNV-1a. Use
+// NewSketchFNV or NewSketchMaphash directly to be explicit about (or pick a
+// different) hash function.
+func NewSketch(depth, width int) *DataSketch {
+	return NewSketchFNV(depth, width)
+}
 
-	// Write the values in the summary slice to the byte slice.
-	i := 0
-	for _, x := range ts.Summary {
-		buf[1+i] = byte(x)
-		i = i + 1
+// minEpsilonDelta is the floor clamped onto epsilon and delta in
+// NewWithEstimates: both must be in (0, 1) for the standard Count-Min Sketch
+// sizing formulas to produce a usable depth and width, and values at or
+// below 0 would otherwise overflow or zero out the computed dimensions.
+const minEpsilonDelta = 1e-9
+
+// NewWithEstimates creates a sketch sized so that frequency estimates are
+// off by at most epsilon*N with probability 1-delta, where N is the total
+// number of inserts. Width is ceil(e/epsilon) and depth is ceil(ln(1/delta)),
+// the standard Count-Min Sketch parameterization. epsilon and delta are
+// clamped to (0, 1) first, since a non-positive epsilon or a delta >= 1
+// would otherwise overflow or zero out the computed dimensions and panic
+// deep inside Add/Count instead of at construction. Clamping epsilon alone
+// isn't enough to keep width sane (an epsilon near the floor still asks for
+// billions of counters), so width is additionally capped against
+// maxSketchCells, the same depth*width bound Deserialize enforces.
+func NewWithEstimates(epsilon, delta float64) *DataSketch {
+	if epsilon < minEpsilonDelta {
+		epsilon = minEpsilonDelta
+	} else if epsilon >= 1 {
+		epsilon = 1 - minEpsilonDelta
+	}
+	if delta < minEpsilonDelta {
+		delta = minEpsilonDelta
+	} else if delta >= 1 {
+		delta = 1 - minEpsilonDelta
+	}
+	width := int(math.Ceil(math.E / epsilon))
+	depth := int(math.Ceil(math.Log(1 / delta)))
+	if depth < 1 {
+		depth = 1
 	}
+	if maxWidth := maxSketchCells / depth; width > maxWidth {
+		width = maxWidth
+	}
+	return NewSketch(depth, width)
+}
 
-	// Return the serialized sketch.
-	return buf
+// NewSketchFNV creates a sketch that hashes items with FNV-1a. Heavy-hitter
+// tracking is on from the start (see EnableHeavyHitters); call
+// DisableHeavyHitters if the sketch will never be queried with
+// HeavyHitters and the per-Add bookkeeping isn't wanted.
+func NewSketchFNV(depth, width int) *DataSketch {
+	ts := newSketch(depth, width, "fnv64", hashFNV)
+	ts.EnableHeavyHitters()
+	return ts
 }
 
-// Deserialize deserializes a sketch from a byte slice.
-// The byte slice must have the following format:
-//   - The first byte is the length of the summary slice.
-//   - The next `len(summary)` bytes are the values in the summary slice.
-func (ts *DataSketch) Deserialize(data []byte) error {
-	// Get the length of the summary slice.
-	n := len(data)
+// NewSketchMaphash creates a sketch that hashes items with hash/maphash
+// using the given seed. Independently-created sketches must share the same
+// seed to be combined with Union, Intersection, ANotB, or MergeReader: the
+// seed is folded into HashID so Compatible actually rejects a mismatch
+// instead of treating every maphash sketch as interchangeable. As with
+// NewSketchFNV, heavy-hitter tracking is on from the start.
+func NewSketchMaphash(depth, width int, seed maphash.Seed) *DataSketch {
+	ts := newSketch(depth, width, fmt.Sprintf("maphash:%x", seed), hashMaphash(seed))
+	ts.EnableHeavyHitters()
+	return ts
+}
 
-	// Check if the byte slice has the correct format.
-	if n < 1 {
-		return fmt.Errorf("invalid data")
+func newSketch(depth, width int, hashID string, hashFunc func([]byte) uint64) *DataSketch {
+	summary := make([][]uint64, depth)
+	for i := range summary {
+		summary[i] = make([]uint64, width)
 	}
-
-	// Initialize the summary slice.
-	ts.Summary = make([]int, n-1)
-
-	// Deserialize the values in the summary slice.
-	for i := 1; i < n; i++ {
-		ts.Summary[i-1] = int(data[i])
+	return &DataSketch{
+		Depth:    depth,
+		Width:    width,
+		Summary:  summary,
+		HashID:   hashID,
+		hashFunc: hashFunc,
 	}
+}
 
-	// Return nil if the deserialization was successful.
-	return nil
+// hashFNV hashes x with FNV-1a.
+func hashFNV(x []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(x)
+	return h.Sum64()
 }
 
-// return maximum value
-func min(val1 int, val2 int) int {
-	if val1 < val2 {
-		return val1
+// hashMaphash returns a hash function that hashes x with hash/maphash using
+// the given seed.
+func hashMaphash(seed maphash.Seed) func([]byte) uint64 {
+	return func(x []byte) uint64 {
+		var h maphash.Hash
+		h.SetSeed(seed)
+		h.Write(x)
+		return h.Sum64()
 	}
-	return val2
 }
 
-// return minimum value
-func max(val1 int, val2 int) int {
-	if val1 > val2 {
-		return val1
-	}
-	return val2
+// bucket returns the counter index for the given row, derived from the
+// hash pair via double hashing.
+func (ts *DataSketch) bucket(row int, h1, h2 uint32) int {
+	return int((uint64(h1) + uint64(row)*uint64(h2)) % uint64(ts.Width))
 }
 
-// Union returns a new sketch that is the union of the two given sketches.
-// The union is created by adding the counts from the two sketches together.
-func (ts *DataSketch) Union(other *DataSketch) *DataSketch {
-	// Create a new sketch.
-	newTs := NewSketch(ts.HashFunc)
+// Add increments the estimated count of x by one.
+func (ts *DataSketch) Add(x []byte) {
+	ts.AddN(x, 1)
+}
 
-	// Iterate over the summaries of the two sketches and add the counts together.
-	for i := range ts.Summary {
-		newTs.Summary[i] += ts.Summary[i] + other.Summary[i]
+// AddN increments the estimated count of x by n, updating every row.
+func (ts *DataSketch) AddN(x []byte, n uint64) {
+	sum := ts.hashFunc(x)
+	h1, h2 := uint32(sum>>32), uint32(sum)
+	for row := 0; row < ts.Depth; row++ {
+		ts.Summary[row][ts.bucket(row, h1, h2)] += n
 	}
-
-	// Return the new sketch.
-	return newTs
+	ts.N += n
+	ts.trackHeavyHitter(x, n)
 }
 
-// Intersection returns a new sketch that is the intersection of the two given sketches.
-// The intersection is created by taking the minimum of the counts from the two sketches.
-func (ts *DataSketch) Intersection(other *DataSketch) *DataSketch {
-	// Create a new sketch.
-	newTs := NewSketch(ts.HashFunc)
-
-	// Iterate over the summaries of the two sketches and take the minimum of the counts.
-	for i := range ts.Summary {
-		newTs.Summary[i] = min(ts.Summary[i], other.Summary[i])
+// Count returns the estimated frequency of x: the minimum counter across
+// all rows, the standard Count-Min Sketch point-query estimate.
+func (ts *DataSketch) Count(x []byte) uint64 {
+	sum := ts.hashFunc(x)
+	h1, h2 := uint32(sum>>32), uint32(sum)
+	min := ts.Summary[0][ts.bucket(0, h1, h2)]
+	for row := 1; row < ts.Depth; row++ {
+		if c := ts.Summary[row][ts.bucket(row, h1, h2)]; c < min {
+			min = c
+		}
 	}
-
-	// Return the new sketch.
-	return newTs
+	return min
 }
 
-// ANotB returns a new sketch that is the difference between the two given sketches.
-// The difference is created by taking the difference of the counts from the two sketches.
-func (ts *DataSketch) ANotB(other *DataSketch) *DataSketch {
-	// Create a new sketch.
-	newTs := NewSketch(ts.HashFunc)
-
-	// Iterate over the summaries of the two sketches and take the difference of the counts.
-	for i := range ts.Summary {
-		newTs.Summary[i] = max(0, ts.Summary[i]-other.Summary[i])
+// min64 returns the smaller of two uint64 values.
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
 	}
-
-	// Return the new sketch.
-	return newTs
+	return b
 }
 
+// Union, Intersection, and ANotB live in merge.go alongside the
+// compatibility checks they rely on.
+
 // main is the entry point for the program.
 func main() {
 
-	// Create two sketches
-	// Add elements to the  sketches
-	ts1 := NewSketch(func(x int) int { return x % 10 })
+	// Create two sketches and add elements to them.
+	ts1 := NewWithEstimates(0.01, 0.01)
 	for i := 0; i < 100; i++ {
-		ts1.Add(rand.Intn(10))
+		AddT(ts1, i%10, IntKey)
 	}
 
-	ts2 := NewSketch(func(x int) int { return x % 10 })
+	ts2 := NewWithEstimates(0.01, 0.01)
 	for i := 0; i < 50; i++ {
-		ts2.Add(rand.Intn(10))
+		AddT(ts2, i%10, IntKey)
 	}
 
-	// Print the cardinality of the  sketches
-	fmt.Println("ts1:", ts1.EstimateCardinality())
-	fmt.Println("ts2:", ts2.EstimateCardinality())
+	// Print the estimated count of item 3 in each sketch.
+	fmt.Println("ts1 count(3):", CountT(ts1, 3, IntKey))
+	fmt.Println("ts2 count(3):", CountT(ts2, 3, IntKey))
 
-	// Create a new  sketch that is the union of ts1 and ts2
-	newTs := ts1.Union(ts2)
-	fmt.Println("ts1 union ts2:", newTs.EstimateCardinality())
+	// Create a new sketch that is the union of ts1 and ts2.
+	newTs, err := ts1.Union(ts2)
+	if err != nil {
+		fmt.Println("union failed:", err)
+		return
+	}
+	fmt.Println("ts1 union ts2, count(3):", CountT(newTs, 3, IntKey))
 
-	// Create a new  sketch that is the intersection of ts1 and ts2.
-	newTs = ts1.Intersection(ts2)
-	fmt.Println("ts1 intersection ts2:", newTs.EstimateCardinality())
+	// Create a new sketch that is the intersection of ts1 and ts2.
+	newTs, err = ts1.Intersection(ts2)
+	if err != nil {
+		fmt.Println("intersection failed:", err)
+		return
+	}
+	fmt.Println("ts1 intersection ts2, count(3):", CountT(newTs, 3, IntKey))
 
-	// Create a new  sketch that is the ANotB of ts1 and ts2.
-	newTs = ts1.ANotB(ts2)
-	fmt.Println("ts1 ANotB ts2:", newTs.EstimateCardinality())
+	// Create a new sketch that is the ANotB of ts1 and ts2.
+	newTs, err = ts1.ANotB(ts2)
+	if err != nil {
+		fmt.Println("ANotB failed:", err)
+		return
+	}
+	fmt.Println("ts1 ANotB ts2, count(3):", CountT(newTs, 3, IntKey))
 
 }